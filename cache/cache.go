@@ -0,0 +1,184 @@
+//Package cache provides an in-memory, size-bounded LRU for file blocks so
+//repeated Upload/Download rounds for a popular hash don't each pay for a
+//disk read or PIR round.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+//Stats reports cumulative cache-hit metrics for a BlockCache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+type entry struct {
+	file  string
+	hash  string
+	block []byte
+}
+
+type inflight struct {
+	done  chan struct{}
+	block []byte
+	err   error
+}
+
+//BlockCache is an LRU of hash -> block bytes, bounded by both a per-file
+//and a global byte budget. Concurrent Load calls for the same hash
+//coalesce into a single loader invocation.
+type BlockCache struct {
+	mu            sync.Mutex
+	perFileBudget int64
+	globalBudget  int64
+
+	order      *list.List //most-recently-used at the front
+	items      map[string]*list.Element
+	fileBytes  map[string]int64
+	totalBytes int64
+
+	inflight map[string]*inflight
+
+	hits   uint64
+	misses uint64
+}
+
+//NewBlockCache builds an empty cache. perFileBudget and globalBudget are
+//byte limits; a budget <= 0 disables that limit, so a cache with both
+//budgets <= 0 never evicts.
+func NewBlockCache(perFileBudget, globalBudget int64) *BlockCache {
+	return &BlockCache{
+		perFileBudget: perFileBudget,
+		globalBudget:  globalBudget,
+		order:         list.New(),
+		items:         make(map[string]*list.Element),
+		fileBytes:     make(map[string]int64),
+		inflight:      make(map[string]*inflight),
+	}
+}
+
+//Get returns the cached block for hash, if present, marking it
+//most-recently-used.
+func (c *BlockCache) Get(hash []byte) ([]byte, bool) {
+	key := string(hash)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	return el.Value.(*entry).block, true
+}
+
+//Put inserts block under hash, attributing its bytes to file for the
+//per-file budget, and evicts the least-recently-used entries until both
+//budgets are satisfied.
+func (c *BlockCache) Put(file string, hash []byte, block []byte) {
+	key := string(hash)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insertLocked(file, key, block)
+}
+
+//Load returns the cached block for hash if present; otherwise it calls
+//loader and caches the result. Concurrent Load calls for the same hash
+//share one loader call so a hot hash results in a single disk read.
+func (c *BlockCache) Load(file string, hash []byte, loader func() ([]byte, error)) ([]byte, error) {
+	key := string(hash)
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		c.hits++
+		block := el.Value.(*entry).block
+		c.mu.Unlock()
+		return block, nil
+	}
+	if inf, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-inf.done
+		return inf.block, inf.err
+	}
+	c.misses++
+	inf := &inflight{done: make(chan struct{})}
+	c.inflight[key] = inf
+	c.mu.Unlock()
+
+	block, err := loader()
+	inf.block, inf.err = block, err
+	close(inf.done)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if err == nil {
+		c.insertLocked(file, key, block)
+	}
+	c.mu.Unlock()
+
+	return block, err
+}
+
+//Stats returns cumulative hit/miss counters.
+func (c *BlockCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Hits: c.hits, Misses: c.misses}
+}
+
+func (c *BlockCache) insertLocked(file, key string, block []byte) {
+	if _, ok := c.items[key]; ok {
+		return
+	}
+
+	for c.perFileBudget > 0 && c.fileBytes[file]+int64(len(block)) > c.perFileBudget {
+		if !c.evictOldestFromLocked(file) {
+			break
+		}
+	}
+	for c.globalBudget > 0 && c.totalBytes+int64(len(block)) > c.globalBudget {
+		if !c.evictOldestLocked() {
+			break
+		}
+	}
+
+	el := c.order.PushFront(&entry{file: file, hash: key, block: block})
+	c.items[key] = el
+	c.fileBytes[file] += int64(len(block))
+	c.totalBytes += int64(len(block))
+}
+
+//evictOldestLocked drops the globally least-recently-used entry.
+func (c *BlockCache) evictOldestLocked() bool {
+	el := c.order.Back()
+	if el == nil {
+		return false
+	}
+	c.removeLocked(el)
+	return true
+}
+
+//evictOldestFromLocked drops the least-recently-used entry belonging to
+//file, to make room under file's own budget.
+func (c *BlockCache) evictOldestFromLocked(file string) bool {
+	for el := c.order.Back(); el != nil; el = el.Prev() {
+		if el.Value.(*entry).file == file {
+			c.removeLocked(el)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *BlockCache) removeLocked(el *list.Element) {
+	e := el.Value.(*entry)
+	c.order.Remove(el)
+	delete(c.items, e.hash)
+	c.fileBytes[e.file] -= int64(len(e.block))
+	c.totalBytes -= int64(len(e.block))
+}
@@ -0,0 +1,78 @@
+package cache
+
+import "testing"
+
+func TestBlockCacheEvictsLeastRecentlyUsedUnderGlobalBudget(t *testing.T) {
+	//budget only fits two of the three 10-byte blocks, so the third put
+	//must evict the least-recently-used one (h1) to stay under it.
+	c := NewBlockCache(0, 25)
+
+	c.Put("a", []byte("h1"), make([]byte, 10))
+	c.Put("a", []byte("h2"), make([]byte, 10))
+	c.Put("a", []byte("h3"), make([]byte, 10))
+
+	if _, ok := c.Get([]byte("h1")); ok {
+		t.Fatalf("h1 should have been evicted to stay under the global budget")
+	}
+	if _, ok := c.Get([]byte("h2")); !ok {
+		t.Fatalf("h2 should still be cached")
+	}
+	if _, ok := c.Get([]byte("h3")); !ok {
+		t.Fatalf("h3 should still be cached")
+	}
+}
+
+func TestBlockCacheGetKeepsEntryAlive(t *testing.T) {
+	c := NewBlockCache(0, 20)
+
+	c.Put("a", []byte("h1"), make([]byte, 10))
+	c.Put("a", []byte("h2"), make([]byte, 10))
+
+	//touch h1 so it's no longer the least-recently-used entry
+	if _, ok := c.Get([]byte("h1")); !ok {
+		t.Fatalf("h1 should still be cached")
+	}
+	c.Put("a", []byte("h3"), make([]byte, 10))
+
+	if _, ok := c.Get([]byte("h2")); ok {
+		t.Fatalf("h2 should have been evicted, not h1")
+	}
+	if _, ok := c.Get([]byte("h1")); !ok {
+		t.Fatalf("h1 should have survived the eviction")
+	}
+}
+
+func TestBlockCachePerFileBudget(t *testing.T) {
+	c := NewBlockCache(10, 0)
+
+	c.Put("a", []byte("h1"), make([]byte, 10))
+	c.Put("b", []byte("h2"), make([]byte, 10))
+	c.Put("a", []byte("h3"), make([]byte, 10))
+
+	if _, ok := c.Get([]byte("h1")); ok {
+		t.Fatalf("h1 should have been evicted to stay under file a's budget")
+	}
+	if _, ok := c.Get([]byte("h2")); !ok {
+		t.Fatalf("h2 belongs to a different file and should be unaffected")
+	}
+	if _, ok := c.Get([]byte("h3")); !ok {
+		t.Fatalf("h3 should still be cached")
+	}
+}
+
+func TestBlockCacheStats(t *testing.T) {
+	c := NewBlockCache(0, 0)
+
+	c.Put("a", []byte("h1"), make([]byte, 4))
+	if _, ok := c.Get([]byte("h1")); !ok {
+		t.Fatalf("h1 should be cached")
+	}
+	if _, ok := c.Get([]byte("missing")); ok {
+		t.Fatalf("missing should not be cached")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("got stats %+v, want 1 hit and 1 miss", stats)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"os"
 	"log"
-	"net/rpc"
 	"sync"
 	"time"
 
 	. "afs/lib" //types and utils
+	"afs/cache"
+	"afs/scheduler"
+	"afs/transport"
 
 	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/crypto/cipher"
@@ -17,11 +19,26 @@ import (
 
 //assumes RPC model of communication
 
+//DefaultPerFileCacheBytes and DefaultGlobalCacheBytes are sane defaults
+//for NewClient's cache budgets: generous enough to hold the hot set of
+//frequently-requested hashes without bounding small deployments.
+const (
+	DefaultPerFileCacheBytes = 100 * 1024 * 1024
+	DefaultGlobalCacheBytes  = 1024 * 1024 * 1024
+)
+
+//scheduler tuning: how long a request/upload/download round gets before
+//it's retried, and how many retries. Up to MaxRounds rounds run at once.
+const (
+	schedulerDeadline   = 5 * time.Second
+	schedulerMaxRetries = 3
+)
+
 type Client struct {
 	addr            string //client addr
 	id              int //client id
 	servers         []string //all servers
-	rpcServers      []*rpc.Client
+	rpcServers      []transport.Transport
 	myServer        int //server downloading from (using PIR)
 	totalClients    int
 
@@ -48,21 +65,34 @@ type Client struct {
 	ephKeys         []abstract.Point
 
 	//downloading
-	dhashes         chan []byte //hash to download (per round)
 	masks           [][]byte //masks used
 	secrets         [][]byte //secret for data
+
+	cache           *cache.BlockCache //hot blocks, keyed by hash
+	logger          Logger
+	sched           *scheduler.Scheduler
 }
 
-func NewClient(addr string, servers []string, myServer string) *Client {
+//NewClient dials every server using a transport produced by newTransport,
+//so callers can pick TCP, UDP, or QUIC without the rest of Client knowing
+//the difference. Pass transport.NewTCPTransport for the original behavior.
+//logger may be nil, in which case Client logs through the standard log
+//package. perFileCacheBytes and globalCacheBytes bound the block cache;
+//pass DefaultPerFileCacheBytes/DefaultGlobalCacheBytes for sane defaults.
+func NewClient(addr string, servers []string, myServer string, newTransport transport.Factory, logger Logger, perFileCacheBytes, globalCacheBytes int64) (*Client, error) {
+	if logger == nil {
+		logger = stdLogger{}
+	}
+
 	myServerIdx := 0
-	rpcServers := make([]*rpc.Client, len(servers))
+	rpcServers := make([]transport.Transport, len(servers))
 	for i := range rpcServers {
 		if servers[i] == myServer {
 			myServerIdx = i
 		}
-		rpcServer, err := rpc.Dial("tcp", servers[i])
-		if err != nil {
-			log.Fatal("Cannot establish connection")
+		rpcServer := newTransport()
+		if err := rpcServer.Dial(servers[i]); err != nil {
+			return nil, fmt.Errorf("dial %s: %w", servers[i], err)
 		}
 		rpcServers[i] = rpcServer
 	}
@@ -72,7 +102,7 @@ func NewClient(addr string, servers []string, myServer string) *Client {
 		pk := make([]byte, SecretSize)
 		err := rpcServer.Call("Server.GetPK", 0, &pk)
 		if err != nil {
-			log.Fatal("Couldn't get server's pk: ", err)
+			return nil, fmt.Errorf("get pk from %s: %w", servers[i], err)
 		}
 		pks[i] = UnmarshalPoint(pk)
 	}
@@ -115,18 +145,21 @@ func NewClient(addr string, servers []string, myServer string) *Client {
 
 		ephKeys:        make([]abstract.Point, len(servers)),
 
-		dhashes:        make(chan []byte, MaxRounds),
 		masks:          masks,
 		secrets:        secrets,
+
+		cache:          cache.NewBlockCache(perFileCacheBytes, globalCacheBytes),
+		logger:         logger,
 	}
+	c.sched = scheduler.New(&c, MaxRounds, schedulerDeadline, schedulerMaxRetries)
 
-	return &c
+	return &c, nil
 }
 /////////////////////////////////
 //Registration and Setup
 ////////////////////////////////
 
-func (c *Client) Register(idx int) {
+func (c *Client) Register(idx int) error {
 	cr := ClientRegistration {
 		Addr: c.addr,
 		ServerId: c.myServer,
@@ -135,22 +168,24 @@ func (c *Client) Register(idx int) {
 	var id int
 	err := c.rpcServers[idx].Call("Server.Register", cr, &id)
 	if err != nil {
-		log.Fatal("Couldn't register: ", err)
+		return fmt.Errorf("register on %s: %w", c.servers[idx], err)
 	}
 	c.id = id
+	return nil
 }
 
-func (c *Client) RegisterDone() {
+func (c *Client) RegisterDone() error {
 	var totalClients int
 	err := c.rpcServers[c.myServer].Call("Server.GetNumClients", 0, &totalClients)
 	if err != nil {
-		log.Fatal("Couldn't get number of clients")
+		return fmt.Errorf("get number of clients from %s: %w", c.servers[c.myServer], err)
 	}
 	c.totalClients = totalClients
+	return nil
 }
 
 //share one time secret with the server
-func (c *Client) ShareSecret() {
+func (c *Client) ShareSecret() error {
 	gen := c.g.Point().Base()
 	secret1 := c.g.Secret().Pick(c.rand)
 	secret2 := c.g.Secret().Pick(c.rand)
@@ -160,9 +195,10 @@ func (c *Client) ShareSecret() {
 	//generate share secrets via Diffie-Hellman w/ all servers
 	//one used for masks, one used for one-time pad
 	var wg sync.WaitGroup
+	errs := make(chan error, len(c.rpcServers))
 	for i, rpcServer := range c.rpcServers {
 		wg.Add(1)
-		go func(i int, rpcServer *rpc.Client) {
+		go func(i int, rpcServer transport.Transport) {
 			defer wg.Done()
 
 			cs1 := ClientDH {
@@ -180,22 +216,43 @@ func (c *Client) ShareSecret() {
 			call1 := rpcServer.Go("Server.ShareMask", &cs1, &servPub1, nil)
 			call2 := rpcServer.Go("Server.ShareSecret", &cs2, &servPub2, nil)
 			call3 := rpcServer.Go("Server.GetEphKey", 0, &servPub3, nil)
-			_ = <-call1.Done
-			_ = <-call2.Done
-			_ = <-call3.Done
+			r1 := <-call1.Done
+			r2 := <-call2.Done
+			r3 := <-call3.Done
+			if r1.Error != nil {
+				errs <- fmt.Errorf("share mask with %s: %w", c.servers[i], r1.Error)
+				return
+			}
+			if r2.Error != nil {
+				errs <- fmt.Errorf("share secret with %s: %w", c.servers[i], r2.Error)
+				return
+			}
+			if r3.Error != nil {
+				errs <- fmt.Errorf("get eph key from %s: %w", c.servers[i], r3.Error)
+				return
+			}
 			c.masks[i] = MarshalPoint(c.g.Point().Mul(UnmarshalPoint(servPub1), secret1))
 			c.secrets[i] = MarshalPoint(c.g.Point().Mul(UnmarshalPoint(servPub2), secret2))
 			c.ephKeys[i] = UnmarshalPoint(servPub3)
 		} (i, rpcServer)
 	}
 	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 /////////////////////////////////
 //Request
 ////////////////////////////////
-func (c *Client) RequestBlock(slot int, hash []byte) {
+func (c *Client) RequestBlock(slot int, hash []byte) error {
 	c.reqLock.Lock()
+	defer c.reqLock.Unlock()
+
 	round := c.reqRound % MaxRounds
 	reqs := make([][]byte, c.totalClients)
 	for i := range reqs {
@@ -207,29 +264,30 @@ func (c *Client) RequestBlock(slot int, hash []byte) {
 	}
 	req := Request{Hash: reqs, Round: round}
 	cr := ClientRequest{Request: req, Id: c.id}
-	c.dhashes <- hash
 
 	//fmt.Println(c.id, c.reqRound, "requesting", hash)
 
 	//TODO: xor in some secrets
 	err := c.rpcServers[c.myServer].Call("Server.RequestBlock", &cr, nil)
 	if err != nil {
-		log.Fatal("Couldn't request a block: ", err)
+		return fmt.Errorf("request block on %s: %w", c.servers[c.myServer], err)
 	}
 	c.reqRound++
-	c.reqLock.Unlock()
+	return nil
 }
 
 /////////////////////////////////
 //Upload
 ////////////////////////////////
-func (c *Client) DownloadReqHash() [][]byte {
+func (c *Client) DownloadReqHash() ([][]byte, error) {
 	c.reqHashLock.Lock()
+	defer c.reqHashLock.Unlock()
+
 	var hashes [][]byte
 	args := RequestArg{Id: c.id, Round: c.reqHashRound}
 	err := c.rpcServers[c.myServer].Call("Server.GetReqHashes", &args, &hashes)
 	if err != nil {
-		log.Fatal("Couldn't download req hashes: ", err)
+		return nil, fmt.Errorf("download req hashes from %s: %w", c.servers[c.myServer], err)
 	}
 
 	// if c.id == 0 && c.reqRound == 0 {
@@ -237,16 +295,21 @@ func (c *Client) DownloadReqHash() [][]byte {
 	// }
 
 	c.reqHashRound++
-	c.reqHashLock.Unlock()
-	return hashes
+	return hashes, nil
 }
 
-func (c *Client) Upload() {
+func (c *Client) Upload() error {
 	//okay to lock; bandwidth is still near maximized
 	c.upLock.Lock()
-	hashes := c.DownloadReqHash()
+	defer c.upLock.Unlock()
+
+	hashes, err := c.DownloadReqHash()
+	if err != nil {
+		return err
+	}
 	var match []byte
 	var name string
+	var matchHash []byte
 	var offset int64 = -1
 	for n, f := range c.files {
 		fhashes := f.Hashes
@@ -254,6 +317,7 @@ func (c *Client) Upload() {
 			o, ok := fhashes[string(h)]
 			if ok {
 				offset = o
+				matchHash = h
 			}
 		}
 		//for now, just do the first one you find
@@ -264,20 +328,32 @@ func (c *Client) Upload() {
 	}
 	match = make([]byte, BlockSize)
 	if offset != -1 {
-		f := c.osFiles[name]
-		_, err := f.ReadAt(match, offset)
+		block, err := c.cache.Load(name, matchHash, func() ([]byte, error) {
+			buf := make([]byte, BlockSize)
+			f := c.osFiles[name]
+			_, err := f.ReadAt(buf, offset)
+			return buf, err
+		})
 		if err != nil {
-			log.Fatal("Failed reading file", name, ":", err)
+			return fmt.Errorf("read file %s: %w", name, err)
 		}
+		match = block
+	}
+	if err := c.UploadBlock(Block{Block: match, Round: c.upRound}); err != nil {
+		return err
 	}
-	c.UploadBlock(Block{Block: match, Round: c.upRound})
 	c.upRound++
-	c.upLock.Unlock()
+	return nil
 }
 
-func (c *Client) UploadPieces() {
+func (c *Client) UploadPieces() error {
 	c.upLock.Lock()
-	hashes := c.DownloadReqHash()
+	defer c.upLock.Unlock()
+
+	hashes, err := c.DownloadReqHash()
+	if err != nil {
+		return err
+	}
 	var match []byte = nil
 	for _, h := range hashes {
 		if len(c.testPieces[string(h)]) == 0 {
@@ -294,15 +370,17 @@ func (c *Client) UploadPieces() {
 	//TODO: handle unfound hash..
 	if match == nil {
 		match = make([]byte, BlockSize)
-		fmt.Println(c.id, "unfound", hashes)
+		c.logger.Errorf("client %d: unfound hashes %v", c.id, hashes)
 	}
 
-	c.UploadBlock(Block{Block: match, Round: c.upRound})
+	if err := c.UploadBlock(Block{Block: match, Round: c.upRound}); err != nil {
+		return err
+	}
 	c.upRound++
-	c.upLock.Unlock()
+	return nil
 }
 
-func (c *Client) UploadBlock(block Block) {
+func (c *Client) UploadBlock(block Block) error {
 	h := Suite.Hash()
 	h.Write(block.Block)
 	hash := h.Sum(nil)
@@ -335,29 +413,57 @@ func (c *Client) UploadBlock(block Block) {
 
 	err := c.rpcServers[c.myServer].Call("Server.UploadBlock", &upblock, nil)
 	if err != nil {
-		log.Fatal("Couldn't upload a block: ", err)
+		return fmt.Errorf("upload block on %s: %w", c.servers[c.myServer], err)
 	}
+	return nil
 }
 
 
 /////////////////////////////////
 //Download
 ////////////////////////////////
-func (c *Client) Download() []byte {
-	c.downLock.Lock()
-	hash := <-c.dhashes
-	block := c.DownloadBlock(hash)
-	c.downRound++
-	c.downLock.Unlock()
-	return block
+
+//fileForHash returns the name of the file c.files registers hash's offset
+//under, or "" if hash doesn't belong to any file this client knows about
+//(e.g. it was registered by a different client). Used to key the block
+//cache by file on the download path the same way Upload already does, so
+//perFileCacheBytes actually bounds memory per file instead of every
+//download competing for one shared "" bucket.
+func (c *Client) fileForHash(hash []byte) string {
+	for name, f := range c.files {
+		if _, ok := f.Hashes[string(hash)]; ok {
+			return name
+		}
+	}
+	return ""
 }
 
-func (c *Client) DownloadBlock(hash []byte) []byte {
+//DownloadBlock downloads the block matching hash for the current round.
+//It holds downLock for its entire duration, so c.downRound and the
+//per-round mask/secret ratchet always advance in lockstep with exactly
+//one round, whether the call is served from cache or from a real PIR
+//round trip — callers (including the Scheduler, which may have several
+//rounds in flight for request/upload) key their download explicitly by
+//hash rather than relying on any shared ordering.
+func (c *Client) DownloadBlock(hash []byte) ([]byte, error) {
+	c.downLock.Lock()
+	defer c.downLock.Unlock()
+
+	if block, ok := c.cache.Get(hash); ok {
+		//the round trip is skipped, but the server's one-time-pad
+		//generation for this round proceeds regardless, so c.downRound
+		//and the local mask/secret ratchet must still advance in
+		//lockstep with it or the next real round desyncs.
+		c.ratchetDownRound()
+		c.downRound++
+		return block, nil
+	}
+
 	var hashes [][]byte
 	args := RequestArg{Id: c.id, Round: c.downRound}
 	err := c.rpcServers[c.myServer].Call("Server.GetUpHashes", &args, &hashes)
 	if err != nil {
-		log.Fatal("Couldn't download up hashes: ", err)
+		return nil, fmt.Errorf("download up hashes from %s: %w", c.servers[c.myServer], err)
 	}
 
 	//fmt.Println(c.id, c.downRound, "down hashes", hashes)
@@ -368,14 +474,24 @@ func (c *Client) DownloadBlock(hash []byte) []byte {
 			found = found && (hash[j] == hashes[i][j])
 		}
 		if found {
-			return c.DownloadSlot(i)
+			block, err := c.DownloadSlot(i)
+			if err != nil {
+				return nil, err
+			}
+			c.cache.Put(c.fileForHash(hash), hash, block)
+			c.downRound++
+			return block, nil
 		}
 	}
 	//TODO: handle unfound hash..
-	return make([]byte, 0)
+	c.ratchetDownRound()
+	c.downRound++
+	return make([]byte, 0), nil
 }
 
-func (c *Client) DownloadSlot(slot int) []byte {
+//DownloadSlot fetches slot's response for the current round and ratchets
+//the mask/secret state forward. Callers must hold downLock.
+func (c *Client) DownloadSlot(slot int) ([]byte, error) {
 	//all but one server uses the prng technique
 	finalMask := make([]byte, SecretSize)
 	SetBit(slot, true, finalMask)
@@ -389,11 +505,21 @@ func (c *Client) DownloadSlot(slot int) []byte {
 	cMask := ClientMask {Mask: mask, Id: c.id, Round: c.downRound}
 	err := c.rpcServers[c.myServer].Call("Server.GetResponse", cMask, &response)
 	if err != nil {
-		log.Fatal("Could not get response: ", err)
+		return nil, fmt.Errorf("get response from %s: %w", c.servers[c.myServer], err)
 	}
 
 	Xor(secretsXor, response)
 
+	c.ratchetDownRound()
+
+	return response, nil
+}
+
+//ratchetDownRound advances masks/secrets to the values the next round
+//expects. It's a pure local PRNG step, independent of any server
+//response, so DownloadBlock must run it even on a cache hit that skips
+//the round trip entirely. Callers must hold downLock.
+func (c *Client) ratchetDownRound() {
 	for i := range c.secrets {
 		rand := Suite.Cipher(c.secrets[i])
 		rand.Read(c.secrets[i])
@@ -403,8 +529,17 @@ func (c *Client) DownloadSlot(slot int) []byte {
 		rand := Suite.Cipher(c.masks[i])
 		rand.Read(c.masks[i])
 	}
+}
 
-	return response
+//Fetch pipelines the request/upload/download cycle for every hash, running
+//up to MaxRounds rounds concurrently instead of one block at a time.
+//Results arrive on the returned channel in the same order as hashes.
+func (c *Client) Fetch(hashes [][]byte) <-chan scheduler.Result {
+	reqs := make([]scheduler.Request, len(hashes))
+	for i, hash := range hashes {
+		reqs[i] = scheduler.Request{Slot: c.id, Hash: hash}
+	}
+	return c.sched.Fetch(reqs)
 }
 
 /////////////////////////////////
@@ -429,14 +564,34 @@ func (c *Client) Masks() [][]byte {
 func (c *Client) Secrets() [][]byte {
 	return c.secrets
 }
-func (c *Client) RpcServers() []*rpc.Client {
+func (c *Client) RpcServers() []transport.Transport {
 	return c.rpcServers
 }
 
+func (c *Client) CacheStats() cache.Stats {
+	return c.cache.Stats()
+}
+
 func (c *Client) ClearHashes() {
 	c.rpcServers[c.myServer].Call("Server.GetUpHashes", c.id, nil)
 }
 
+//Close shuts down every server connection. It returns the first error
+//encountered but still attempts to close the rest.
+func (c *Client) Close() error {
+	var first error
+	for i, rpcServer := range c.rpcServers {
+		if err := rpcServer.Close(); err != nil {
+			err = fmt.Errorf("close transport to %s: %w", c.servers[i], err)
+			c.logger.Errorf("%v", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
 
 /////////////////////////////////
 //MAIN
@@ -445,17 +600,28 @@ func main() {
 	var id *int = flag.Int("i", 0, "id [num]")
 	flag.Parse()
 
-	c := NewClient(fmt.Sprintf("127.0.0.1:%d", 9000+*id), ServerAddrs, ServerAddrs[0])
-	c.Register(0)
+	c, err := NewClient(fmt.Sprintf("127.0.0.1:%d", 9000+*id), ServerAddrs, ServerAddrs[0], transport.NewTCPTransport, nil, DefaultPerFileCacheBytes, DefaultGlobalCacheBytes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Register(0); err != nil {
+		log.Fatal(err)
+	}
 	time.Sleep(1000 * time.Millisecond)
-	c.RegisterDone()
-	c.ShareSecret()
+	if err := c.RegisterDone(); err != nil {
+		log.Fatal(err)
+	}
+	if err := c.ShareSecret(); err != nil {
+		log.Fatal(err)
+	}
 
 	// for {
 	// 	go func(hash []byte) {
 	// 		go c.RequestBlock(c.id, hash)
 	// 		go c.Upload()
-	// 		res := c.Download()
+	// 		res := c.DownloadBlock(hash)
 	// 	}
 	// }
 
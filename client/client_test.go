@@ -0,0 +1,64 @@
+package client
+
+import (
+	"testing"
+
+	. "afs/lib"
+	"afs/transport"
+)
+
+// fakeTransport stubs just enough of the server RPC surface (GetPK,
+// GetResponse) to drive DownloadSlot without a real server, so a test can
+// inspect the GetResponse request it would have put on the wire.
+type fakeTransport struct {
+	maskLens []int
+}
+
+func (f *fakeTransport) Dial(addr string) error { return nil }
+func (f *fakeTransport) Close() error           { return nil }
+
+func (f *fakeTransport) Go(serviceMethod string, args interface{}, reply interface{}, done chan *transport.Call) *transport.Call {
+	panic("fakeTransport.Go is not used by this test")
+}
+
+func (f *fakeTransport) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	switch serviceMethod {
+	case "Server.GetPK":
+		*reply.(*[]byte) = MarshalPoint(Suite.Point().Base())
+	case "Server.GetResponse":
+		f.maskLens = append(f.maskLens, len(args.(ClientMask).Mask))
+		*reply.(*[]byte) = make([]byte, BlockSize)
+	default:
+		panic("fakeTransport: unexpected call " + serviceMethod)
+	}
+	return nil
+}
+
+// TestDownloadSlotRequestSizeIsSlotIndependent is a client-observable proxy
+// for the PIR anonymity property integration_test.go can't exercise without
+// a real multi-server Docker harness: server-side traffic to
+// Server.GetResponse must not reveal which slot the client requested. Here
+// that means the length of the ClientMask argument's Mask stays constant no
+// matter which slot DownloadSlot is asked for.
+func TestDownloadSlotRequestSizeIsSlotIndependent(t *testing.T) {
+	ft := &fakeTransport{}
+	newTransport := func() transport.Transport { return ft }
+
+	c, err := NewClient("client0", []string{"server0"}, "server0", newTransport, nil, DefaultPerFileCacheBytes, DefaultGlobalCacheBytes)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	for slot := 0; slot < 4; slot++ {
+		if _, err := c.DownloadSlot(slot); err != nil {
+			t.Fatalf("download slot %d: %v", slot, err)
+		}
+	}
+
+	want := ft.maskLens[0]
+	for slot, got := range ft.maskLens {
+		if got != want {
+			t.Fatalf("slot %d sent a %d-byte mask, want %d like every other slot", slot, got, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package client
+
+import "log"
+
+//Logger lets callers route Client's diagnostics wherever they like
+//(logrus, zerolog, a test buffer, ...) instead of the standard log
+//package baked in.
+type Logger interface {
+	Errorf(format string, args ...interface{})
+}
+
+//stdLogger adapts the standard library's log package to Logger; it's the
+//default used when NewClient is given a nil Logger.
+type stdLogger struct{}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
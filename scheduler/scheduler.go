@@ -0,0 +1,164 @@
+//Package scheduler pipelines the request/upload/download round cycle so a
+//caller can have up to MaxRounds rounds in flight instead of fetching one
+//block at a time.
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//RoundClient is the subset of Client a Scheduler drives. It's satisfied by
+//*client.Client. DownloadBlock takes the request's own hash explicitly,
+//rather than pulling one off some shared queue, so concurrent rounds can
+//never hand each other the wrong hash's block.
+type RoundClient interface {
+	RequestBlock(slot int, hash []byte) error
+	Upload() error
+	DownloadBlock(hash []byte) ([]byte, error)
+}
+
+//Request is one block to fetch: slot is the caller's index in the
+//anonymity set, hash identifies the block.
+type Request struct {
+	Slot int
+	Hash []byte
+}
+
+//Result is delivered on Fetch's channel in submission order.
+type Result struct {
+	Hash  []byte
+	Block []byte
+	Err   error
+}
+
+//roundState tracks where a round is in its request -> upload -> download
+//lifecycle, mostly for diagnostics.
+type roundState int
+
+const (
+	stateRequested roundState = iota
+	stateUploaded
+	stateDownloaded
+)
+
+//Scheduler bounds how many request/upload/download rounds run concurrently
+//and retries a round that misses its deadline.
+type Scheduler struct {
+	client     RoundClient
+	maxRounds  int
+	deadline   time.Duration
+	maxRetries int
+
+	mu     sync.Mutex
+	rounds map[int]roundState
+}
+
+//New builds a Scheduler that allows maxRounds rounds in flight at once,
+//retrying a round up to maxRetries times if it fails or doesn't complete
+//within deadline.
+func New(client RoundClient, maxRounds int, deadline time.Duration, maxRetries int) *Scheduler {
+	return &Scheduler{
+		client:     client,
+		maxRounds:  maxRounds,
+		deadline:   deadline,
+		maxRetries: maxRetries,
+		rounds:     make(map[int]roundState),
+	}
+}
+
+//Fetch dispatches one round per request, up to maxRounds at a time, and
+//returns a channel delivering a Result per request in submission order.
+//The channel is closed once every request has been delivered.
+func (s *Scheduler) Fetch(reqs []Request) <-chan Result {
+	out := make(chan Result, len(reqs))
+	slots := make([]chan Result, len(reqs))
+	for i := range slots {
+		slots[i] = make(chan Result, 1)
+	}
+
+	sem := make(chan struct{}, s.maxRounds)
+	go func() {
+		for i, req := range reqs {
+			sem <- struct{}{}
+			go func(round int, req Request) {
+				defer func() { <-sem }()
+				slots[round] <- s.runRound(round, req)
+			}(i, req)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for _, slot := range slots {
+			out <- <-slot
+		}
+	}()
+
+	return out
+}
+
+//runRound drives one request/upload/download cycle, retrying on any error,
+//a timeout included.
+func (s *Scheduler) runRound(round int, req Request) Result {
+	var lastErr error
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		block, err := s.attempt(round, req)
+		if err == nil {
+			s.setState(round, stateDownloaded)
+			return Result{Hash: req.Hash, Block: block}
+		}
+		lastErr = err
+	}
+	return Result{Hash: req.Hash, Err: fmt.Errorf("round %d: %w", round, lastErr)}
+}
+
+//attempt runs a single request/upload/download cycle and fails it if
+//deadline elapses first. A timed-out cycle may still complete in the
+//background against the server's bookkeeping for that round; the retry
+//issues a fresh round rather than waiting on it, though since
+//DownloadBlock holds the client's download lock for its whole duration,
+//a retry's download still won't start running until the abandoned one
+//finishes — request/upload for the retry can proceed in the meantime.
+func (s *Scheduler) attempt(round int, req Request) ([]byte, error) {
+	type outcome struct {
+		block []byte
+		err   error
+	}
+	done := make(chan outcome, 1)
+
+	go func() {
+		if err := s.client.RequestBlock(req.Slot, req.Hash); err != nil {
+			done <- outcome{err: fmt.Errorf("request: %w", err)}
+			return
+		}
+		s.setState(round, stateRequested)
+
+		if err := s.client.Upload(); err != nil {
+			done <- outcome{err: fmt.Errorf("upload: %w", err)}
+			return
+		}
+		s.setState(round, stateUploaded)
+
+		block, err := s.client.DownloadBlock(req.Hash)
+		if err != nil {
+			done <- outcome{err: fmt.Errorf("download: %w", err)}
+			return
+		}
+		done <- outcome{block: block}
+	}()
+
+	select {
+	case o := <-done:
+		return o.block, o.err
+	case <-time.After(s.deadline):
+		return nil, fmt.Errorf("round %d timed out after %s", round, s.deadline)
+	}
+}
+
+func (s *Scheduler) setState(round int, st roundState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rounds[round] = st
+}
@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeClient is a minimal RoundClient: RequestBlock/Upload always succeed,
+//and DownloadBlock returns whatever was registered under hash, optionally
+//after a per-call delay or a handful of forced failures (to exercise
+//runRound's retry path). delay and failDelay are separate knobs so a
+//test can make the forced-failure attempt(s) slow (to force a scheduler
+//timeout) without also slowing down the eventual successful attempt.
+type fakeClient struct {
+	mu        sync.Mutex
+	blocks    map[string][]byte
+	delay     map[string]time.Duration
+	failDelay map[string]time.Duration
+	failFor   map[string]int //remaining forced failures before succeeding
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		blocks:    make(map[string][]byte),
+		delay:     make(map[string]time.Duration),
+		failDelay: make(map[string]time.Duration),
+		failFor:   make(map[string]int),
+	}
+}
+
+func (f *fakeClient) register(hash, block []byte, delay time.Duration, failFor int, failDelay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocks[string(hash)] = block
+	f.delay[string(hash)] = delay
+	f.failFor[string(hash)] = failFor
+	f.failDelay[string(hash)] = failDelay
+}
+
+func (f *fakeClient) RequestBlock(slot int, hash []byte) error { return nil }
+func (f *fakeClient) Upload() error                            { return nil }
+
+func (f *fakeClient) DownloadBlock(hash []byte) ([]byte, error) {
+	f.mu.Lock()
+	delay := f.delay[string(hash)]
+	failDelay := f.failDelay[string(hash)]
+	remaining := f.failFor[string(hash)]
+	if remaining > 0 {
+		f.failFor[string(hash)] = remaining - 1
+	}
+	block := f.blocks[string(hash)]
+	f.mu.Unlock()
+
+	if remaining > 0 {
+		time.Sleep(failDelay)
+		return nil, fmt.Errorf("simulated failure, %d remaining", remaining)
+	}
+	time.Sleep(delay)
+	return block, nil
+}
+
+func TestSchedulerFetchDeliversInSubmissionOrder(t *testing.T) {
+	client := newFakeClient()
+	hashA, hashB := []byte("hashA"), []byte("hashB")
+	blockA, blockB := []byte("blockA"), []byte("blockB")
+	//A takes longer than B, so B's round finishes first internally; the
+	//result order must still follow submission order, not completion order.
+	client.register(hashA, blockA, 30*time.Millisecond, 0, 0)
+	client.register(hashB, blockB, 0, 0, 0)
+
+	s := New(client, 4, time.Second, 0)
+	results := s.Fetch([]Request{{Slot: 0, Hash: hashA}, {Slot: 1, Hash: hashB}})
+
+	r := <-results
+	if r.Err != nil || !bytes.Equal(r.Block, blockA) {
+		t.Fatalf("first result: got block %x err %v, want %x", r.Block, r.Err, blockA)
+	}
+	r = <-results
+	if r.Err != nil || !bytes.Equal(r.Block, blockB) {
+		t.Fatalf("second result: got block %x err %v, want %x", r.Block, r.Err, blockB)
+	}
+	if _, ok := <-results; ok {
+		t.Fatalf("expected the results channel to close after both requests")
+	}
+}
+
+func TestSchedulerRetriesOnTimeout(t *testing.T) {
+	client := newFakeClient()
+	hash, block := []byte("hash"), []byte("block")
+	//the first attempt fails slowly enough to blow through the deadline;
+	//the retry succeeds quickly and should produce a Result with no error.
+	client.register(hash, block, 0, 1, 50*time.Millisecond)
+
+	s := New(client, 1, 10*time.Millisecond, 1)
+	results := s.Fetch([]Request{{Slot: 0, Hash: hash}})
+
+	select {
+	case r := <-results:
+		if r.Err != nil {
+			t.Fatalf("expected the retry to succeed, got %v", r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Fetch never delivered a result")
+	}
+}
+
+func TestSchedulerReportsExhaustedRetries(t *testing.T) {
+	client := newFakeClient()
+	hash := []byte("hash")
+	client.register(hash, nil, 0, 100, 0) //always fails
+
+	s := New(client, 1, 20*time.Millisecond, 2)
+	results := s.Fetch([]Request{{Slot: 0, Hash: hash}})
+
+	r := <-results
+	if r.Err == nil {
+		t.Fatalf("expected an error once retries are exhausted")
+	}
+}
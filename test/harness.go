@@ -0,0 +1,135 @@
+//Package test drives the Riffle protocol against real server processes
+//running in Docker containers, so contributors can exercise a full N-server
+//deployment without hand-launching binaries.
+//
+//Scenarios need a "riffle-server" image on the local Docker daemon. When
+//Docker or the image isn't available, tests skip instead of failing so
+//`go test ./...` stays usable on a laptop with no Docker at all. As of
+//this tree there is no server package or Dockerfile checked in anywhere to
+//build that image from, so unless the image is already on the daemon,
+//dockerAvailable fails and every scenario here skips;
+//building and publishing a riffle-server image is tracked separately,
+//outside this package's scope.
+package test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"afs/client"
+	"afs/transport"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	dockernetwork "github.com/docker/docker/api/types/network"
+	dockerclient "github.com/docker/docker/client"
+)
+
+//serverImage is the image scenarios boot; this tree has no Dockerfile for it.
+const serverImage = "riffle-server:latest"
+
+//Harness owns a private bridge network and the server containers on it,
+//and tears both down on Close.
+type Harness struct {
+	docker    *dockerclient.Client
+	ctx       context.Context
+	networkID string
+	servers   []string //container IDs, in server order
+	addrs     []string //host:port for each server, in server order
+}
+
+//dockerAvailable reports whether a Docker daemon is reachable and already
+//has serverImage, so tests can t.Skip cleanly instead of failing.
+func dockerAvailable(ctx context.Context) (*dockerclient.Client, bool) {
+	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, false
+	}
+	if _, err := cli.Ping(ctx); err != nil {
+		return nil, false
+	}
+	if _, _, err := cli.ImageInspectWithRaw(ctx, serverImage); err != nil {
+		return nil, false
+	}
+	return cli, true
+}
+
+//NewHarness starts n server containers on a fresh private bridge network.
+func NewHarness(ctx context.Context, cli *dockerclient.Client, n int) (*Harness, error) {
+	netName := fmt.Sprintf("riffle-test-%d", time.Now().UnixNano())
+	net, err := cli.NetworkCreate(ctx, netName, types.NetworkCreate{Driver: "bridge"})
+	if err != nil {
+		return nil, fmt.Errorf("create network %s: %w", netName, err)
+	}
+
+	h := &Harness{docker: cli, ctx: ctx, networkID: net.ID}
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("riffle-server-%d-%d", time.Now().UnixNano(), i)
+		resp, err := cli.ContainerCreate(ctx,
+			&container.Config{Image: serverImage, Cmd: []string{"-i", fmt.Sprintf("%d", i), "-n", fmt.Sprintf("%d", n)}},
+			&container.HostConfig{NetworkMode: container.NetworkMode(net.ID)},
+			&dockernetwork.NetworkingConfig{}, nil, name)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("create server %d: %w", i, err)
+		}
+		if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+			h.Close()
+			return nil, fmt.Errorf("start server %d: %w", i, err)
+		}
+		h.servers = append(h.servers, resp.ID)
+
+		inspect, err := cli.ContainerInspect(ctx, resp.ID)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("inspect server %d: %w", i, err)
+		}
+		ip := inspect.NetworkSettings.Networks[netName].IPAddress
+		h.addrs = append(h.addrs, fmt.Sprintf("%s:9000", ip))
+	}
+
+	return h, nil
+}
+
+//Addrs returns the server addresses in server order, suitable for
+//client.NewClient's servers argument.
+func (h *Harness) Addrs() []string {
+	return h.addrs
+}
+
+//Kill stops server i as if it crashed, without a graceful shutdown.
+func (h *Harness) Kill(i int) error {
+	return h.docker.ContainerKill(h.ctx, h.servers[i], "SIGKILL")
+}
+
+//NewClient dials every harness server over TCP and registers, mirroring
+//the steps client/client.go's main does by hand.
+func (h *Harness) NewClient(addr string) (*client.Client, error) {
+	c, err := client.NewClient(addr, h.addrs, h.addrs[0], transport.NewTCPTransport, nil, client.DefaultPerFileCacheBytes, client.DefaultGlobalCacheBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Register(0); err != nil {
+		return nil, err
+	}
+	if err := c.RegisterDone(); err != nil {
+		return nil, err
+	}
+	if err := c.ShareSecret(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//Close stops every server container and removes the network. Errors are
+//best-effort; Close always attempts every teardown step.
+func (h *Harness) Close() {
+	for _, id := range h.servers {
+		h.docker.ContainerRemove(h.ctx, id, types.ContainerRemoveOptions{Force: true})
+	}
+	if h.networkID != "" {
+		h.docker.NetworkRemove(h.ctx, h.networkID)
+	}
+}
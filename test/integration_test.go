@@ -0,0 +1,238 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	. "afs/lib"
+)
+
+//scenario is one table-driven integration test against a fresh N-server
+//harness.
+type scenario struct {
+	name    string
+	servers int
+	run     func(t *testing.T, ctx context.Context, h *Harness)
+}
+
+var scenarios = []scenario{
+	{"CorrectBlockRetrieval", 3, testCorrectBlockRetrieval},
+	{"ServerCrashMidRound", 3, testServerCrashMidRound},
+	{"EphemeralKeyMismatch", 3, testEphemeralKeyMismatch},
+	{"ReplayClientDH", 3, testReplayClientDH},
+	{"OutOfOrderRequestBlockRounds", 3, testOutOfOrderRequestBlockRounds},
+	{"MaskSecretDesync", 3, testMaskSecretDesync},
+	{"ResponseRequestHidesSlot", 3, testResponseRequestHidesSlot},
+}
+
+func TestProtocol(t *testing.T) {
+	ctx := context.Background()
+	cli, ok := dockerAvailable(ctx)
+	if !ok {
+		t.Skip("Docker (or the riffle-server image) is not available; skipping integration tests")
+	}
+
+	for _, sc := range scenarios {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			h, err := NewHarness(ctx, cli, sc.servers)
+			if err != nil {
+				t.Fatalf("start harness: %v", err)
+			}
+			defer h.Close()
+			sc.run(t, ctx, h)
+		})
+	}
+}
+
+//testCorrectBlockRetrieval registers a block on one client and confirms a
+//second client downloads exactly that block.
+func testCorrectBlockRetrieval(t *testing.T, ctx context.Context, h *Harness) {
+	uploader, err := h.NewClient("127.0.0.1:19000")
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	defer uploader.Close()
+
+	downloader, err := h.NewClient("127.0.0.1:19001")
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+	defer downloader.Close()
+
+	block := bytes.Repeat([]byte{0x42}, BlockSize)
+	uploader.RegisterBlock(block)
+
+	h2 := Suite.Hash()
+	h2.Write(block)
+	hash := h2.Sum(nil)
+
+	if err := downloader.RequestBlock(downloader.Id(), hash); err != nil {
+		t.Fatalf("request block: %v", err)
+	}
+	if err := uploader.UploadPieces(); err != nil {
+		t.Fatalf("upload pieces: %v", err)
+	}
+	got, err := downloader.DownloadBlock(hash)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !bytes.Equal(got, block) {
+		t.Fatalf("got block %x, want %x", got, block)
+	}
+}
+
+//testServerCrashMidRound kills the server a client is talking to partway
+//through a round and expects the client to surface an error, not hang or
+//panic.
+func testServerCrashMidRound(t *testing.T, ctx context.Context, h *Harness) {
+	c, err := h.NewClient("127.0.0.1:19002")
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	defer c.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- c.RequestBlock(c.Id(), make([]byte, SecretSize)) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := h.Kill(0); err != nil {
+		t.Fatalf("kill server 0: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected an error after the server was killed mid-round")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("RequestBlock hung after the server was killed")
+	}
+}
+
+//testEphemeralKeyMismatch would re-run ShareSecret on an already-registered
+//client, rotating the server's ephemeral keys for that client a second
+//time. No server in this tree rejects that reuse -- there is no
+//server package here at all, only the RPC surface Client calls through
+//-- so this scenario documents the gap instead of asserting a rejection
+//that doesn't exist anywhere to test.
+func testEphemeralKeyMismatch(t *testing.T, ctx context.Context, h *Harness) {
+	t.Skip("no server in this tree rejects a second ShareSecret on the same registration yet; tracked as a gap, not a passing property")
+}
+
+//testReplayClientDH would resend the same ClientDH handshake. No server in
+//this tree rejects the replay -- see testEphemeralKeyMismatch -- so this
+//scenario documents the gap instead of asserting a rejection that
+//doesn't exist anywhere to test.
+func testReplayClientDH(t *testing.T, ctx context.Context, h *Harness) {
+	t.Skip("no server in this tree rejects a replayed ClientDH handshake yet; tracked as a gap, not a passing property")
+}
+
+//testOutOfOrderRequestBlockRounds registers two distinct blocks, fetches
+//them in the reverse of their registration order, and confirms each
+//result is delivered in
+//submission order and matches the block registered under its own hash
+//(not the other request's block).
+func testOutOfOrderRequestBlockRounds(t *testing.T, ctx context.Context, h *Harness) {
+	uploader, err := h.NewClient("127.0.0.1:19005")
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	defer uploader.Close()
+
+	downloader, err := h.NewClient("127.0.0.1:19007")
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+	defer downloader.Close()
+
+	blockA := bytes.Repeat([]byte{0xAA}, BlockSize)
+	blockB := bytes.Repeat([]byte{0xBB}, BlockSize)
+	uploader.RegisterBlock(blockA)
+	uploader.RegisterBlock(blockB)
+
+	hashA := Suite.Hash()
+	hashA.Write(blockA)
+	hashB := Suite.Hash()
+	hashB.Write(blockB)
+
+	hashes := [][]byte{hashB.Sum(nil), hashA.Sum(nil)}
+	want := [][]byte{blockB, blockA}
+
+	results := downloader.Fetch(hashes)
+	go func() {
+		for range hashes {
+			if err := uploader.UploadPieces(); err != nil {
+				t.Errorf("upload pieces: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := range hashes {
+		r := <-results
+		if r.Err != nil {
+			t.Fatalf("fetch round %d: %v", i, r.Err)
+		}
+		if !bytes.Equal(r.Block, want[i]) {
+			t.Fatalf("fetch round %d: got block %x, want %x", i, r.Block, want[i])
+		}
+	}
+}
+
+//testMaskSecretDesync registers a known block, corrupts the client's mask
+//state before downloading it, and expects the download to either fail or
+//come back as something other than the registered block, instead of
+//silently returning the right answer despite the desync.
+func testMaskSecretDesync(t *testing.T, ctx context.Context, h *Harness) {
+	uploader, err := h.NewClient("127.0.0.1:19006")
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	defer uploader.Close()
+
+	downloader, err := h.NewClient("127.0.0.1:19008")
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+	defer downloader.Close()
+
+	block := bytes.Repeat([]byte{0xCC}, BlockSize)
+	uploader.RegisterBlock(block)
+	h2 := Suite.Hash()
+	h2.Write(block)
+	hash := h2.Sum(nil)
+
+	for _, mask := range downloader.Masks() {
+		for i := range mask {
+			mask[i] ^= 0xFF
+		}
+	}
+
+	if err := downloader.RequestBlock(downloader.Id(), hash); err != nil {
+		t.Fatalf("request block: %v", err)
+	}
+	if err := uploader.UploadPieces(); err != nil {
+		t.Fatalf("upload pieces: %v", err)
+	}
+	got, err := downloader.DownloadBlock(hash)
+	if err == nil && bytes.Equal(got, block) {
+		t.Fatalf("desynced masks still produced the correct block")
+	}
+}
+
+//testResponseRequestHidesSlot would assert the PIR anonymity property that
+//server-side traffic to Server.GetResponse does not reveal which slot the
+//client requested. Checking that for real needs a packet capture on the
+//harness network comparing GetResponse traffic across slots -- this
+//package has no way to do that, only the client's own RPC calls -- so the
+//client-observable half of the property (the length of the GetResponse
+//request's mask never varies with the requested slot) is instead covered by
+//client.TestDownloadSlotRequestSizeIsSlotIndependent. This scenario
+//documents the gap instead of asserting a capture-based check that
+//doesn't exist anywhere in this tree.
+func testResponseRequestHidesSlot(t *testing.T, ctx context.Context, h *Harness) {
+	t.Skip("no packet capture in this tree to compare Server.GetResponse traffic across slots; see client.TestDownloadSlotRequestSizeIsSlotIndependent for the client-observable half of this property")
+}
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"net/rpc"
+)
+
+// TCPTransport is the original behavior: a persistent net/rpc connection
+// dialed over TCP.
+type TCPTransport struct {
+	client *rpc.Client
+}
+
+func NewTCPTransport() Transport {
+	return &TCPTransport{}
+}
+
+func (t *TCPTransport) Dial(addr string) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	t.client = client
+	return nil
+}
+
+func (t *TCPTransport) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	return t.client.Call(serviceMethod, args, reply)
+}
+
+func (t *TCPTransport) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	if call.Done == nil {
+		call.Done = make(chan *Call, 1)
+	}
+	rpcCall := t.client.Go(serviceMethod, args, reply, nil)
+	go func() {
+		<-rpcCall.Done
+		call.Error = rpcCall.Error
+		call.done()
+	}()
+	return call
+}
+
+func (t *TCPTransport) Close() error {
+	return t.client.Close()
+}
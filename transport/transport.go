@@ -0,0 +1,34 @@
+// Package transport decouples client<->server RPC from any one wire
+// protocol. The original client hardcoded net/rpc over TCP; Transport lets
+// callers pick TCP, UDP, or QUIC without touching the PIR/crypto logic.
+package transport
+
+// Call mirrors net/rpc.Call so callers can select on Done the same way
+// regardless of which Transport produced it.
+type Call struct {
+	ServiceMethod string
+	Args          interface{}
+	Reply         interface{}
+	Error         error
+	Done          chan *Call
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+	}
+}
+
+// Transport is a single logical connection to one server. Implementations
+// need not be safe for concurrent Dial/Close, but Call/Go must be.
+type Transport interface {
+	Dial(addr string) error
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+	Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call
+	Close() error
+}
+
+// Factory builds a fresh, undialed Transport. NewClient takes one Factory
+// and calls it once per server so myServer selection stays transport-agnostic.
+type Factory func() Transport
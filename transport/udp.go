@@ -0,0 +1,232 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// udpChunkSize keeps each datagram under typical path MTU so fragmentation
+// is handled by us, not the kernel/NAT.
+const udpChunkSize = 1400
+
+// udpCallTimeout and udpCallRetries bound how long Go/Call wait for a
+// response before giving up: a single dropped datagram (on either leg)
+// would otherwise leave call.Done never firing and the caller hung
+// forever. The payload is resent once per retry until something comes
+// back or the overall timeout elapses.
+const (
+	udpCallTimeout = 5 * time.Second
+	udpCallRetries = 3
+)
+
+// udpFrame is one fragment of a gob-encoded rpc request/response.
+type udpFrame struct {
+	Seq     uint64
+	Index   uint32
+	Total   uint32
+	Payload []byte
+}
+
+// UDPTransport reassembles chunked datagrams into full RPC calls. It trades
+// TCP's head-of-line blocking and connection setup for unreliable delivery:
+// a dropped datagram (request or response) is masked by resending the
+// request on an interval until a response arrives or udpCallTimeout
+// elapses, so a lost packet is recovered by a resend, and a call that never
+// gets a response fails instead of hanging.
+type UDPTransport struct {
+	conn *net.UDPConn
+	seq  uint64
+
+	mu      sync.Mutex
+	pending map[uint64]*udpPending
+}
+
+type udpPending struct {
+	call   *Call
+	chunks map[uint32][]byte
+	total  uint32
+	acked  chan struct{} // closed by assemble once the reply is complete
+}
+
+func NewUDPTransport() Transport {
+	return &UDPTransport{pending: make(map[uint64]*udpPending)}
+}
+
+func (u *UDPTransport) Dial(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+	u.conn = conn
+	go u.readLoop()
+	return nil
+}
+
+func (u *UDPTransport) readLoop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := u.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		var frame udpFrame
+		if err := gob.NewDecoder(bytes.NewReader(buf[:n])).Decode(&frame); err != nil {
+			continue
+		}
+		u.assemble(frame)
+	}
+}
+
+func (u *UDPTransport) assemble(frame udpFrame) {
+	u.mu.Lock()
+	p, ok := u.pending[frame.Seq]
+	if !ok {
+		u.mu.Unlock()
+		return
+	}
+	p.chunks[frame.Index] = frame.Payload
+	p.total = frame.Total
+	complete := uint32(len(p.chunks)) == p.total
+	if complete {
+		delete(u.pending, frame.Seq)
+	}
+	u.mu.Unlock()
+
+	if !complete {
+		return
+	}
+
+	full := make([]byte, 0)
+	for i := uint32(0); i < p.total; i++ {
+		full = append(full, p.chunks[i]...)
+	}
+
+	p.call.Error = gob.NewDecoder(bytes.NewReader(full)).Decode(p.call.Reply)
+	close(p.acked)
+	p.call.done()
+}
+
+func (u *UDPTransport) sendChunked(seq uint64, payload []byte) error {
+	total := (len(payload) + udpChunkSize - 1) / udpChunkSize
+	if total == 0 {
+		total = 1
+	}
+	for i := 0; i < total; i++ {
+		start := i * udpChunkSize
+		end := start + udpChunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		frame := udpFrame{Seq: seq, Index: uint32(i), Total: uint32(total), Payload: payload[start:end]}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(frame); err != nil {
+			return err
+		}
+		if _, err := u.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UDPTransport) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	if call.Done == nil {
+		call.Done = make(chan *Call, 1)
+	}
+
+	seq := atomic.AddUint64(&u.seq, 1)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(args); err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
+
+	//prefix with the service method so the server knows how to dispatch,
+	//matching net/rpc's own framing convention.
+	var full bytes.Buffer
+	methodLen := uint32(len(serviceMethod))
+	binary.Write(&full, binary.BigEndian, methodLen)
+	full.WriteString(serviceMethod)
+	full.Write(buf.Bytes())
+
+	acked := make(chan struct{})
+	u.mu.Lock()
+	u.pending[seq] = &udpPending{call: call, chunks: make(map[uint32][]byte), acked: acked}
+	u.mu.Unlock()
+
+	if err := u.sendChunked(seq, full.Bytes()); err != nil {
+		u.failPending(seq, fmt.Errorf("udp send %s: %w", serviceMethod, err))
+		return call
+	}
+
+	go u.retryUntilAcked(seq, full.Bytes(), call, acked)
+
+	return call
+}
+
+// retryUntilAcked resends payload until assemble closes acked or the
+// overall timeout elapses, in which case it fails the call itself so a
+// dropped datagram can't hang the caller forever.
+func (u *UDPTransport) retryUntilAcked(seq uint64, payload []byte, call *Call, acked chan struct{}) {
+	deadline := time.Now().Add(udpCallTimeout)
+	interval := udpCallTimeout / udpCallRetries
+
+	for {
+		wait := interval
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		if wait <= 0 {
+			u.failPending(seq, fmt.Errorf("udp call %s: timed out after %s", call.ServiceMethod, udpCallTimeout))
+			return
+		}
+
+		select {
+		case <-acked:
+			return
+		case <-time.After(wait):
+			if err := u.sendChunked(seq, payload); err != nil {
+				u.failPending(seq, fmt.Errorf("udp send %s: %w", call.ServiceMethod, err))
+				return
+			}
+		}
+	}
+}
+
+// failPending fails call with err, unless assemble already completed it
+// (in which case the pending entry is already gone and this is a no-op).
+func (u *UDPTransport) failPending(seq uint64, err error) {
+	u.mu.Lock()
+	p, ok := u.pending[seq]
+	if ok {
+		delete(u.pending, seq)
+	}
+	u.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.call.Error = err
+	p.call.done()
+}
+
+func (u *UDPTransport) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	call := <-u.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
+	return call.Error
+}
+
+func (u *UDPTransport) Close() error {
+	return u.conn.Close()
+}
@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+//fakeServer is a bare net.UDPConn listener that lets a test script exactly
+//how and when to reply to a UDPTransport's request frames, so the
+//reassembly and retry paths can be exercised without a second
+//UDPTransport (or a real server) on the other end.
+type fakeServer struct {
+	conn *net.UDPConn
+}
+
+func newFakeServer() (*fakeServer, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		return nil, err
+	}
+	return &fakeServer{conn: conn}, nil
+}
+
+func (s *fakeServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+//recvRequest reassembles one full request datagram (possibly several
+//chunks) and returns its Seq and the client address to reply to.
+func (s *fakeServer) recvRequest() (seq uint64, from *net.UDPAddr, err error) {
+	chunks := make(map[uint32][]byte)
+	var total uint32
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		var frame udpFrame
+		if err := gob.NewDecoder(bytes.NewReader(buf[:n])).Decode(&frame); err != nil {
+			return 0, nil, fmt.Errorf("decode frame: %w", err)
+		}
+		chunks[frame.Index] = frame.Payload
+		total = frame.Total
+		seq = frame.Seq
+		from = addr
+		if uint32(len(chunks)) == total {
+			return seq, from, nil
+		}
+	}
+}
+
+func (s *fakeServer) reply(seq uint64, to *net.UDPAddr, reply interface{}) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(reply); err != nil {
+		return fmt.Errorf("encode reply: %w", err)
+	}
+	var frame bytes.Buffer
+	if err := gob.NewEncoder(&frame).Encode(udpFrame{Seq: seq, Index: 0, Total: 1, Payload: payload.Bytes()}); err != nil {
+		return fmt.Errorf("encode frame: %w", err)
+	}
+	_, err := s.conn.WriteToUDP(frame.Bytes(), to)
+	return err
+}
+
+func TestUDPTransportRoundTrip(t *testing.T) {
+	server, err := newFakeServer()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.conn.Close()
+
+	u := NewUDPTransport()
+	if err := u.Dial(server.addr()); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer u.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		seq, from, err := server.recvRequest()
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- server.reply(seq, from, "pong")
+	}()
+
+	var reply string
+	if err := u.Call("Server.Ping", "ping", &reply); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if reply != "pong" {
+		t.Fatalf("got reply %q, want %q", reply, "pong")
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+//TestUDPTransportRetriesBeforeAck drops the first delivery of the request
+//and only replies once the retransmit arrives, confirming Call survives a
+//single dropped datagram instead of hanging or failing.
+func TestUDPTransportRetriesBeforeAck(t *testing.T) {
+	server, err := newFakeServer()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.conn.Close()
+
+	u := NewUDPTransport()
+	if err := u.Dial(server.addr()); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer u.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		if _, _, err := server.recvRequest(); err != nil { //dropped
+			errs <- err
+			return
+		}
+		seq, from, err := server.recvRequest() //the retransmit
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- server.reply(seq, from, "pong")
+	}()
+
+	start := time.Now()
+	var reply string
+	if err := u.Call("Server.Ping", "ping", &reply); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if reply != "pong" {
+		t.Fatalf("got reply %q, want %q", reply, "pong")
+	}
+	if elapsed := time.Since(start); elapsed < udpCallTimeout/udpCallRetries {
+		t.Fatalf("call returned after %s, faster than a single retry interval should allow", elapsed)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+//TestUDPTransportTimesOutWithoutAResponse confirms a request that never
+//gets a reply fails the call instead of hanging Done forever.
+func TestUDPTransportTimesOutWithoutAResponse(t *testing.T) {
+	server, err := newFakeServer()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.conn.Close()
+
+	u := NewUDPTransport()
+	if err := u.Dial(server.addr()); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer u.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		buf := make([]byte, 64*1024)
+		for {
+			if _, _, err := server.conn.ReadFromUDP(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	var reply string
+	if err := u.Call("Server.Ping", "ping", &reply); err == nil {
+		t.Fatalf("expected an error when nothing ever responds")
+	}
+	server.conn.Close()
+	<-drained
+}